@@ -0,0 +1,132 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file runs the cgo preprocessor over a package's CgoFiles so
+// that packages such as net and os/user, and any user package that
+// imports "C", can be loaded and type-checked like ordinary Go
+// packages.
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cgoCache memoizes the result of preprocessing a package's cgo
+// files, keyed by a digest of the package's import path and the
+// mtimes of its CgoFiles, so that a load that touches the same
+// cgo package more than once (e.g. because it is imported by
+// several packages) doesn't re-invoke the cgo tool.
+var (
+	cgoCacheMu sync.Mutex
+	cgoCache   = make(map[string]cgoResult)
+)
+
+type cgoResult struct {
+	files []string // absolute paths of generated Go files
+	err   error
+}
+
+// cgoFiles runs "go tool cgo" over bp.CgoFiles in a scratch
+// directory and returns the absolute paths of the resulting
+// Go source files (typically _cgo_gotypes.go plus one *.cgo1.go
+// per input file). The scratch directory is not removed, so that
+// the cache entry's paths remain valid for the lifetime of the
+// process; callers that load many packages should expect a modest
+// amount of temp-directory growth.
+func cgoFiles(ctxt *build.Context, bp *build.Package) ([]string, error) {
+	if len(bp.CgoFiles) == 0 {
+		return nil, nil
+	}
+
+	key, err := cgoCacheKey(bp)
+	if err != nil {
+		return nil, err
+	}
+
+	cgoCacheMu.Lock()
+	if res, ok := cgoCache[key]; ok {
+		cgoCacheMu.Unlock()
+		return res.files, res.err
+	}
+	cgoCacheMu.Unlock()
+
+	files, err := runCgo(ctxt, bp)
+
+	cgoCacheMu.Lock()
+	cgoCache[key] = cgoResult{files, err}
+	cgoCacheMu.Unlock()
+
+	return files, err
+}
+
+// cgoCacheKey returns a stable key for bp.CgoFiles derived from the
+// package's import path and each file's modification time, so that
+// an edit to any cgo input invalidates the cache entry.
+func cgoCacheKey(bp *build.Package) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, bp.ImportPath)
+	for _, name := range bp.CgoFiles {
+		fi, err := os.Stat(filepath.Join(bp.Dir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h, name, fi.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// runCgo invokes "go tool cgo" on bp.CgoFiles in a fresh temporary
+// directory and returns the absolute paths of the generated Go
+// files that should be parsed alongside bp.GoFiles.
+func runCgo(ctxt *build.Context, bp *build.Package) ([]string, error) {
+	tmpdir, err := ioutil.TempDir("", "gotools-loader-cgo-")
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"tool", "cgo", "-objdir", tmpdir}
+	args = append(args, bp.CgoFiles...)
+
+	cmd := exec.Command(filepath.Join(runtimeGoroot(ctxt), "bin", "go"), args...)
+	cmd.Dir = bp.Dir
+	cmd.Env = append(os.Environ(),
+		"CGO_CFLAGS="+strings.Join(bp.CgoCFLAGS, " "),
+		"CGO_LDFLAGS="+strings.Join(bp.CgoLDFLAGS, " "),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cgo preprocessing of %s failed: %v\n%s", bp.ImportPath, err, out)
+	}
+
+	// The files we care about for type-checking are the generated
+	// Go type declarations and the per-file *.cgo1.go stubs; the
+	// C-facing *.cgo2.c and _cgo_export.[ch] files are irrelevant
+	// here.
+	var files []string
+	for _, name := range []string{"_cgo_gotypes.go"} {
+		files = append(files, filepath.Join(tmpdir, name))
+	}
+	for _, name := range bp.CgoFiles {
+		base := strings.TrimSuffix(filepath.Base(name), ".go")
+		files = append(files, filepath.Join(tmpdir, base+".cgo1.go"))
+	}
+	return files, nil
+}
+
+// runtimeGoroot returns the GOROOT that should be used to locate
+// the "go" tool, preferring ctxt's over the process's own.
+func runtimeGoroot(ctxt *build.Context) string {
+	if ctxt.GOROOT != "" {
+		return ctxt.GOROOT
+	}
+	return build.Default.GOROOT
+}
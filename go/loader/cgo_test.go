@@ -0,0 +1,105 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeCgoFile(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("package p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCgoCacheKeyStableForUnchangedInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeCgoFile(t, dir, "a.go")
+	bp := &build.Package{ImportPath: "example.com/p", Dir: dir, CgoFiles: []string{"a.go"}}
+
+	k1, err := cgoCacheKey(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := cgoCacheKey(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1 != k2 {
+		t.Errorf("cgoCacheKey is not stable across calls: %q != %q", k1, k2)
+	}
+}
+
+func TestCgoCacheKeyChangesWithMtime(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.go")
+	writeCgoFile(t, dir, "a.go")
+	bp := &build.Package{ImportPath: "example.com/p", Dir: dir, CgoFiles: []string{"a.go"}}
+
+	before, err := cgoCacheKey(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := cgoCacheKey(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Errorf("cgoCacheKey did not change after the cgo file's mtime changed")
+	}
+}
+
+// TestCgoFilesCacheHit pre-populates cgoCache for bp's key and
+// checks that cgoFiles returns the cached result without invoking
+// "go tool cgo": ctxt names a GOROOT that doesn't exist, so if
+// runCgo were called despite the cache hit, it would fail.
+func TestCgoFilesCacheHit(t *testing.T) {
+	dir := t.TempDir()
+	writeCgoFile(t, dir, "a.go")
+	bp := &build.Package{ImportPath: "example.com/cachehit", Dir: dir, CgoFiles: []string{"a.go"}}
+
+	key, err := cgoCacheKey(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "_cgo_gotypes.go")}
+	cgoCacheMu.Lock()
+	cgoCache[key] = cgoResult{files: want}
+	cgoCacheMu.Unlock()
+	defer func() {
+		cgoCacheMu.Lock()
+		delete(cgoCache, key)
+		cgoCacheMu.Unlock()
+	}()
+
+	ctxt := &build.Context{GOROOT: filepath.Join(dir, "no-such-goroot")}
+	got, err := cgoFiles(ctxt, bp)
+	if err != nil {
+		t.Fatalf("cgoFiles returned error despite cache hit: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cgoFiles = %v, want cached %v", got, want)
+	}
+}
+
+func TestCgoFilesNoCgoFiles(t *testing.T) {
+	bp := &build.Package{ImportPath: "example.com/nocgo"}
+	files, err := cgoFiles(&build.Default, bp)
+	if err != nil || files != nil {
+		t.Errorf("cgoFiles(no CgoFiles) = %v, %v; want nil, nil", files, err)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines Config, the loader's entry point, and the
+// operations by which a client registers packages to be loaded.
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// A Config specifies the packages to load and the build context,
+// file-set and overlay to load them with. Use one of the Import*
+// or CreateFromFiles methods to add packages, then call FromArgs
+// to interpret a command line, or simply use the config's fields
+// directly.
+type Config struct {
+	// Fset is the file set for positions recorded in the parsed
+	// ASTs. If nil, NewFileSet creates one lazily.
+	Fset *token.FileSet
+
+	// Build is the build context used to locate and import
+	// packages. If nil, &build.Default is used.
+	Build *build.Context
+
+	// Overlay, if non-nil, maps absolute file paths to replacement
+	// file contents, for type-checking unsaved editor buffers
+	// without writing them to disk. See parsePackageFiles.
+	Overlay map[string][]byte
+
+	// CgoEnabled controls whether packages containing
+	// 'import "C"' are preprocessed with the cgo tool. See
+	// parsePackageFiles.
+	CgoEnabled bool
+
+	// CreatePkgs specifies a list of ad-hoc packages to create
+	// from freshly parsed (or already-parsed) files.
+	CreatePkgs []PkgSpec
+
+	// ImportPkgs specifies the set of initial packages to import,
+	// mapping import path to whether to augment the package with
+	// its tests (ImportWithTests) or not (Import).
+	ImportPkgs map[string]bool
+
+	// Driver, if non-nil, is used in place of the default
+	// build.Context-based package discovery, e.g. to make the
+	// loader module-aware via GoListDriver. Selection is
+	// per-Config: leaving this nil preserves the legacy
+	// GOPATH-only behavior.
+	Driver Driver
+
+	// ParserConcurrency bounds the number of files parsed
+	// concurrently across the whole load. Zero (the default)
+	// means GOMAXPROCS. Without a bound, a recursive load of a
+	// large tree (e.g. ImportRecursive over std) can spawn
+	// thousands of concurrent parser.ParseFile calls, one per
+	// file per package.
+	ParserConcurrency int
+
+	limiterOnce sync.Once
+	limiterCh   chan struct{}
+}
+
+// limiter returns the channel used to bound concurrent file
+// parsing, creating it on first use with capacity
+// conf.ParserConcurrency (or GOMAXPROCS if unset).
+func (conf *Config) limiter() chan struct{} {
+	conf.limiterOnce.Do(func() {
+		n := conf.ParserConcurrency
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		conf.limiterCh = make(chan struct{}, n)
+	})
+	return conf.limiterCh
+}
+
+// A PkgSpec specifies a single ad-hoc package to be created by
+// Config.CreatePkgs. Either Files or Filenames (not both) must be
+// set; Path is used as the package's import path for diagnostic
+// purposes only.
+type PkgSpec struct {
+	Path      string      // package path ("" for a default)
+	Files     []*ast.File // already-parsed files, or...
+	Filenames []string    // ...unparsed *.go filenames
+}
+
+// fset returns conf.Fset, initializing it if necessary.
+func (conf *Config) fset() *token.FileSet {
+	if conf.Fset == nil {
+		conf.Fset = token.NewFileSet()
+	}
+	return conf.Fset
+}
+
+// build returns conf.Build, defaulting to &build.Default.
+func (conf *Config) build() *build.Context {
+	if conf.Build == nil {
+		return &build.Default
+	}
+	return conf.Build
+}
+
+// Import adds the package identified by path to the set of initial
+// packages to load, without its tests.
+func (conf *Config) Import(path string) {
+	if conf.ImportPkgs == nil {
+		conf.ImportPkgs = make(map[string]bool)
+	}
+	if !conf.ImportPkgs[path] {
+		conf.ImportPkgs[path] = false
+	}
+}
+
+// ImportWithTests is like Import, but also loads and augments the
+// package with its in-package (*_test.go) and external
+// (*_test.go, package p_test) test files.
+func (conf *Config) ImportWithTests(path string) {
+	if conf.ImportPkgs == nil {
+		conf.ImportPkgs = make(map[string]bool)
+	}
+	conf.ImportPkgs[path] = true
+}
+
+// CreateFromFiles adds an ad-hoc package to the set of initial
+// packages, comprising the specified already-parsed files, with
+// the given import path used only for error messages and the
+// synthetic package's path.
+func (conf *Config) CreateFromFiles(path string, files ...*ast.File) {
+	conf.CreatePkgs = append(conf.CreatePkgs, PkgSpec{Path: path, Files: files})
+}
+
+// CreateFromFilenames is like CreateFromFiles, but the files are
+// named, not yet parsed; they will be parsed (subject to
+// conf.Overlay) when the Config is loaded. The cgo tool is not run
+// over them, whatever the value of conf.CgoEnabled.
+func (conf *Config) CreateFromFilenames(path string, filenames ...string) {
+	conf.CreatePkgs = append(conf.CreatePkgs, PkgSpec{Path: path, Filenames: filenames})
+}
+
+// FromArgs interprets args as a command-line containing a mixture
+// of command-line flags for the tool and either:
+//
+//   - a list of *.go source file names, which are loaded as a
+//     single ad-hoc package (via CreateFromFilenames); the import
+//     path for the "package" may be set using the path=name.go
+//     syntax on the first file, or
+//
+//   - a list of import paths, each of which is added via
+//     conf.Import or, if xtest is true, conf.ImportWithTests.
+//
+// It returns the residue of args, the portion it did not consume,
+// which is typically the flags of the wrapped tool, or an error.
+// The special argument "--" stops FromArgs from consuming any more
+// arguments.
+func (conf *Config) FromArgs(args []string, xtest bool) (rest []string, err error) {
+	var first string
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			return args[1:], nil // consume "--" and return what follows
+		}
+		if !strings.HasSuffix(arg, ".go") {
+			break // not a filename; stop unless this is an import path, handled below
+		}
+		first = arg
+		break
+	}
+
+	if first != "" {
+		// Gather the run of *.go filenames.
+		var filenames []string
+		path := ""
+		for i, arg := range args {
+			if arg == "--" {
+				args = args[i+1:]
+				break
+			}
+			if !strings.HasSuffix(arg, ".go") {
+				args = args[i:]
+				break
+			}
+			if eq := strings.IndexByte(arg, '='); eq >= 0 && i == 0 {
+				path, arg = arg[:eq], arg[eq+1:]
+			}
+			filenames = append(filenames, arg)
+			if i == len(args)-1 {
+				args = nil
+			}
+		}
+		if len(filenames) == 0 {
+			return nil, fmt.Errorf("FromArgs: no *.go source files")
+		}
+		if path == "" {
+			path = "command-line-arguments"
+		}
+		conf.CreateFromFilenames(path, filenames...)
+		return args, nil
+	}
+
+	// Treat the remaining arguments as a list of import paths.
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			args = args[1:]
+			break
+		}
+		if strings.HasPrefix(arg, "-") {
+			break // looks like a flag; stop and return it to the caller
+		}
+		if xtest {
+			conf.ImportWithTests(arg)
+		} else {
+			conf.Import(arg)
+		}
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// ImportRecursive walks the directory tree rooted at root, and adds
+// (via Import) every package it finds whose directory contains at
+// least one *.go file accepted by filter. filter may be nil, in
+// which case all *.go files are accepted; it parallels the filter
+// parameter of parser.ParseDir, letting callers skip *_test.go
+// files, generated files, and so on.
+//
+// The walk does not descend into directories whose name begins
+// with "." or "_", nor into "testdata", matching the convention
+// used by the go tool.
+func (conf *Config) ImportRecursive(root string, filter func(os.FileInfo) bool) error {
+	ctxt := conf.build()
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		base := filepath.Base(path)
+		if path != root && (base[0] == '.' || base[0] == '_' || base == "testdata") {
+			return filepath.SkipDir
+		}
+
+		hasGoFile := false
+		entries, err := readDir(ctxt, path)
+		if err != nil {
+			return err
+		}
+		for _, fi := range entries {
+			if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") {
+				continue
+			}
+			if filter != nil && !filter(fi) {
+				continue
+			}
+			hasGoFile = true
+			break
+		}
+		if !hasGoFile {
+			return nil
+		}
+
+		bp, err := ctxt.ImportDir(path, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return nil
+			}
+			return err
+		}
+		if bp.ImportPath == "." {
+			// ctxt.ImportDir only derives a real import path for
+			// directories under ctxt.GOROOT/src or a GOPATH root;
+			// outside those trees (e.g. a module-mode checkout) it
+			// returns the sentinel ".", which would silently
+			// collapse every such package onto the same
+			// conf.ImportPkgs key. Fail loudly instead, naming the
+			// offending directory, rather than dropping packages.
+			return fmt.Errorf("%s: cannot determine import path (not under GOROOT or a GOPATH root); use a Driver-based Config instead", path)
+		}
+		conf.Import(bp.ImportPath)
+		return nil
+	})
+}
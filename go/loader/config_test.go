@@ -0,0 +1,147 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromArgsFiles(t *testing.T) {
+	for _, test := range []struct {
+		args      []string
+		xtest     bool
+		wantPath  string
+		wantFiles []string
+		wantRest  []string
+	}{
+		{
+			args:      []string{"a.go", "b.go", "--", "-flag"},
+			wantPath:  "command-line-arguments",
+			wantFiles: []string{"a.go", "b.go"},
+			wantRest:  []string{"-flag"},
+		},
+		{
+			args:      []string{"foo/bar=a.go", "b.go"},
+			wantPath:  "foo/bar",
+			wantFiles: []string{"a.go", "b.go"},
+			wantRest:  nil,
+		},
+	} {
+		var conf Config
+		rest, err := conf.FromArgs(test.args, test.xtest)
+		if err != nil {
+			t.Errorf("FromArgs(%v) failed: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(rest, test.wantRest) {
+			t.Errorf("FromArgs(%v): rest = %v, want %v", test.args, rest, test.wantRest)
+		}
+		if len(conf.CreatePkgs) != 1 {
+			t.Fatalf("FromArgs(%v): CreatePkgs = %v, want one PkgSpec", test.args, conf.CreatePkgs)
+		}
+		got := conf.CreatePkgs[0]
+		if got.Path != test.wantPath || !reflect.DeepEqual(got.Filenames, test.wantFiles) {
+			t.Errorf("FromArgs(%v): CreatePkgs[0] = %+v, want {Path: %q, Filenames: %v}",
+				test.args, got, test.wantPath, test.wantFiles)
+		}
+	}
+}
+
+func TestFromArgsImportPaths(t *testing.T) {
+	var conf Config
+	rest, err := conf.FromArgs([]string{"fmt", "net/http", "-flag"}, true)
+	if err != nil {
+		t.Fatalf("FromArgs failed: %v", err)
+	}
+	if !reflect.DeepEqual(rest, []string{"-flag"}) {
+		t.Errorf("rest = %v, want [-flag]", rest)
+	}
+	want := map[string]bool{"fmt": true, "net/http": true}
+	if !reflect.DeepEqual(conf.ImportPkgs, want) {
+		t.Errorf("ImportPkgs = %v, want %v", conf.ImportPkgs, want)
+	}
+}
+
+// writePkg creates dir/name.go containing a trivial package
+// declaration, for ImportRecursive tests.
+func writePkg(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := "package " + name + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportRecursiveGOPATH(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "loader-importrecursive-gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	root := filepath.Join(gopath, "src", "examplerecur")
+	writePkg(t, filepath.Join(root, "pkga"), "pkga")
+	writePkg(t, filepath.Join(root, "pkgb"), "pkgb")
+
+	conf := Config{Build: &build.Context{
+		GOROOT:   build.Default.GOROOT,
+		GOPATH:   gopath,
+		Compiler: build.Default.Compiler,
+	}}
+	if err := conf.ImportRecursive(root, nil); err != nil {
+		t.Fatalf("ImportRecursive: %v", err)
+	}
+
+	want := map[string]bool{"examplerecur/pkga": false, "examplerecur/pkgb": false}
+	if !reflect.DeepEqual(conf.ImportPkgs, want) {
+		t.Errorf("ImportPkgs = %v, want %v", conf.ImportPkgs, want)
+	}
+}
+
+// TestImportRecursiveOutsideGOPATH exercises a directory tree that
+// lies outside any GOPATH root, for which ctxt.ImportDir cannot
+// derive a real import path and returns the "." sentinel.
+// ImportRecursive must report this rather than collapsing every
+// such package onto the single ImportPkgs["."] key.
+func TestImportRecursiveOutsideGOPATH(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "loader-importrecursive-gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	root, err := ioutil.TempDir("", "loader-importrecursive-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writePkg(t, filepath.Join(root, "pkga"), "pkga")
+	writePkg(t, filepath.Join(root, "pkgb"), "pkgb")
+
+	conf := Config{Build: &build.Context{
+		GOROOT:   build.Default.GOROOT,
+		GOPATH:   gopath, // unrelated to root
+		Compiler: build.Default.Compiler,
+	}}
+	err = conf.ImportRecursive(root, nil)
+	if err == nil {
+		t.Fatal("ImportRecursive succeeded, want error naming the ambiguous directory")
+	}
+	if !strings.Contains(err.Error(), "pkga") && !strings.Contains(err.Error(), "pkgb") {
+		t.Errorf("ImportRecursive error = %v, want it to name the offending directory", err)
+	}
+	if len(conf.ImportPkgs) != 0 {
+		t.Errorf("ImportPkgs = %v, want none registered once an ambiguous directory is hit", conf.ImportPkgs)
+	}
+}
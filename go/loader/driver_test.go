@@ -0,0 +1,117 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeGoList writes a stub "go" executable to a new temp directory
+// that, regardless of arguments, prints script to stdout, and
+// returns a PATH with that directory prepended so GoListDriver
+// invokes the stub instead of the real "go" tool.
+func fakeGoList(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "go")
+	contents := "#!/bin/sh\ncat <<'EOF'\n" + script + "\nEOF\n"
+	if err := os.WriteFile(stub, []byte(contents), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir + string(os.PathListSeparator) + os.Getenv("PATH")
+}
+
+func TestGoListDriverPackages(t *testing.T) {
+	const stdout = `{"ImportPath":"example.com/p","Dir":"/src/p","GoFiles":["p.go"],"TestGoFiles":["p_test.go"],"Imports":["fmt"]}
+{"ImportPath":"example.com/q","Dir":"/src/q","GoFiles":["q.go"],"Error":{"Err":"q: build failed"}}
+`
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", fakeGoList(t, stdout))
+	defer os.Setenv("PATH", oldPath)
+
+	d := &GoListDriver{}
+	pkgs, err := d.Packages([]string{"example.com/..."})
+	if err != nil {
+		t.Fatalf("Packages() failed: %v", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("Packages() returned %d packages, want 2", len(pkgs))
+	}
+
+	p := pkgs[0]
+	if p.ImportPath != "example.com/p" || p.Dir != "/src/p" {
+		t.Errorf("pkgs[0] = %+v, want ImportPath=example.com/p Dir=/src/p", p)
+	}
+	if len(p.GoFiles) != 1 || p.GoFiles[0] != "p.go" {
+		t.Errorf("pkgs[0].GoFiles = %v, want [p.go]", p.GoFiles)
+	}
+	if len(p.Imports) != 1 || p.Imports[0] != "fmt" {
+		t.Errorf("pkgs[0].Imports = %v, want [fmt]", p.Imports)
+	}
+
+	q := pkgs[1]
+	if len(q.Errors) != 1 || q.Errors[0] != "q: build failed" {
+		t.Errorf("pkgs[1].Errors = %v, want [q: build failed]", q.Errors)
+	}
+}
+
+// TestGoListDriverPackagesOmitsDeps guards against regressing to
+// "go list -deps", which would return the full transitive
+// dependency closure of each pattern instead of just the packages
+// the caller named.
+func TestGoListDriverPackagesOmitsDeps(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	stub := filepath.Join(dir, "go")
+	contents := "#!/bin/sh\necho \"$@\" > " + argsFile + "\necho '{}'\n"
+	if err := os.WriteFile(stub, []byte(contents), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	d := &GoListDriver{}
+	if _, err := d.Packages([]string{"example.com/..."}); err != nil {
+		t.Fatalf("Packages() failed: %v", err)
+	}
+
+	got, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "-deps") {
+		t.Errorf("go invoked with args %q, want no -deps flag", got)
+	}
+}
+
+func TestGoListDriverPackagesCommandFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "go")
+	if err := os.WriteFile(stub, []byte("#!/bin/sh\necho boom >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	d := &GoListDriver{}
+	if _, err := d.Packages([]string{"example.com/..."}); err == nil {
+		t.Fatal("Packages() succeeded, want error from failing go list")
+	}
+}
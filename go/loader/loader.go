@@ -0,0 +1,146 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines Load, which turns a Config into a Program by
+// parsing every package the Config has been told about, and
+// Program, the result of doing so.
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+)
+
+// A Program is the result of loading a Config: the parsed files of
+// every ad-hoc package registered via CreateFromFiles/
+// CreateFromFilenames, and of every package registered via Import/
+// ImportWithTests, keyed by import path.
+type Program struct {
+	Fset *token.FileSet
+
+	Created  []*PackageFiles          // ad-hoc packages, in CreatePkgs order
+	Imported map[string]*PackageFiles // keyed by import path
+}
+
+// PackageFiles holds the parsed files of a single package loaded by
+// Load.
+type PackageFiles struct {
+	Path  string
+	Files []*ast.File
+}
+
+// Load parses every package registered with conf via Import,
+// ImportWithTests, CreateFromFiles or CreateFromFilenames, and
+// returns the result as a Program.
+//
+// Parsing honours conf.Overlay and conf.ParserConcurrency (the
+// latter via conf.limiter, which is shared across every package
+// loaded by this call, bounding the total number of concurrent
+// parser.ParseFile calls regardless of how many packages are
+// involved).
+//
+// If conf.Driver is set, it is used to discover each imported
+// package's files, making the load module- and vendor-aware;
+// otherwise package discovery falls back to the legacy
+// build.Context-based logic in parsePackageFiles, which also
+// honours conf.CgoEnabled.
+func (conf *Config) Load() (*Program, error) {
+	fset := conf.fset()
+	limiter := conf.limiter()
+
+	prog := &Program{
+		Fset:     fset,
+		Imported: make(map[string]*PackageFiles),
+	}
+
+	for _, spec := range conf.CreatePkgs {
+		files := spec.Files
+		if files == nil {
+			parsed, err := parseFiles(fset, "", spec.Filenames, conf.Overlay, limiter)
+			if err != nil {
+				return nil, fmt.Errorf("loading %s: %v", spec.Path, err)
+			}
+			files = parsed
+		}
+		prog.Created = append(prog.Created, &PackageFiles{Path: spec.Path, Files: files})
+	}
+
+	if conf.Driver != nil {
+		if err := conf.loadViaDriver(prog); err != nil {
+			return nil, err
+		}
+		return prog, nil
+	}
+
+	ctxt := conf.build()
+	for path, tests := range conf.ImportPkgs {
+		which := "g"
+		if tests {
+			which = "gtx"
+		}
+		files, err := parsePackageFiles(ctxt, fset, path, which, conf.Overlay, conf.CgoEnabled, limiter)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %v", path, err)
+		}
+		prog.Imported[path] = &PackageFiles{Path: path, Files: files}
+	}
+	return prog, nil
+}
+
+// loadViaDriver populates prog.Imported using conf.Driver rather
+// than build.Context.Import, for each package registered via
+// Import/ImportWithTests.
+func (conf *Config) loadViaDriver(prog *Program) error {
+	fset := conf.fset()
+	limiter := conf.limiter()
+
+	var patterns []string
+	for path := range conf.ImportPkgs {
+		patterns = append(patterns, path)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	dpkgs, err := conf.Driver.Packages(patterns)
+	if err != nil {
+		return fmt.Errorf("loading driver packages: %v", err)
+	}
+
+	for _, dp := range dpkgs {
+		if len(dp.Errors) > 0 {
+			return fmt.Errorf("loading %s: %s", dp.ImportPath, dp.Errors[0])
+		}
+
+		filenames := append([]string{}, dp.GoFiles...)
+		if conf.ImportPkgs[dp.ImportPath] {
+			filenames = append(filenames, dp.TestGoFiles...)
+			filenames = append(filenames, dp.XTestGoFiles...)
+		}
+
+		files, err := parseFiles(fset, dp.Dir, filenames, conf.Overlay, limiter)
+		if err != nil {
+			return fmt.Errorf("loading %s: %v", dp.ImportPath, err)
+		}
+
+		if conf.CgoEnabled && len(dp.CgoFiles) > 0 {
+			bp := &build.Package{ImportPath: dp.ImportPath, Dir: dp.Dir, CgoFiles: dp.CgoFiles}
+			generated, err := cgoFiles(conf.build(), bp)
+			if err != nil {
+				return fmt.Errorf("cgo preprocessing failed for %q: %v", dp.ImportPath, err)
+			}
+			genAST, err := parseFiles(fset, "", generated, nil, limiter)
+			if err != nil {
+				return err
+			}
+			files = append(files, genAST...)
+		}
+
+		prog.Imported[dp.ImportPath] = &PackageFiles{Path: dp.ImportPath, Files: files}
+	}
+	return nil
+}
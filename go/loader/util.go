@@ -8,28 +8,131 @@ package loader
 // and used by it.
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
 	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
+// overlayContext returns a copy of ctxt whose OpenFile, IsDir and
+// ReadDir hooks are aware of overlay, a map from absolute file path
+// to replacement file contents. Files named by overlay are served
+// from memory; all other paths fall through to the real filesystem
+// (or to ctxt's existing hooks, if set). If overlay is empty, ctxt
+// is returned unchanged.
+//
+// This lets callers such as editor/IDE integrations type-check
+// unsaved buffers without writing them to disk first.
+func overlayContext(ctxt *build.Context, overlay map[string][]byte) *build.Context {
+	if len(overlay) == 0 {
+		return ctxt
+	}
+
+	// Collect the set of directories that contain overlay files, so
+	// that ReadDir can synthesize entries for them even if the file
+	// doesn't yet exist on disk.
+	dirContents := make(map[string]map[string]bool) // dir -> set of basenames
+	for filename := range overlay {
+		dir := filepath.Dir(filename)
+		names := dirContents[dir]
+		if names == nil {
+			names = make(map[string]bool)
+			dirContents[dir] = names
+		}
+		names[filepath.Base(filename)] = true
+	}
+
+	ctxt2 := *ctxt // copy
+	ctxt2.OpenFile = func(path string) (io.ReadCloser, error) {
+		if contents, ok := overlay[path]; ok {
+			return ioutil.NopCloser(bytes.NewReader(contents)), nil
+		}
+		if ctxt.OpenFile != nil {
+			return ctxt.OpenFile(path)
+		}
+		return os.Open(path)
+	}
+	ctxt2.IsDir = func(path string) bool {
+		if _, ok := dirContents[path]; ok {
+			return true
+		}
+		if ctxt.IsDir != nil {
+			return ctxt.IsDir(path)
+		}
+		fi, err := os.Stat(path)
+		return err == nil && fi.IsDir()
+	}
+	ctxt2.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		fis, err := readDir(ctxt, dir)
+		if err != nil && len(dirContents[dir]) == 0 {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, fi := range fis {
+			seen[fi.Name()] = true
+		}
+		for name := range dirContents[dir] {
+			if !seen[name] {
+				fis = append(fis, fakeOverlayFileInfo(name))
+			}
+		}
+		return fis, nil
+	}
+	return &ctxt2
+}
+
+// readDir lists dir using ctxt's ReadDir hook if it has one,
+// otherwise the real filesystem, mirroring the fallback build.Context
+// applies internally (but does not expose) when its hooks are nil.
+func readDir(ctxt *build.Context, dir string) ([]os.FileInfo, error) {
+	if ctxt.ReadDir != nil {
+		return ctxt.ReadDir(dir)
+	}
+	return ioutil.ReadDir(dir)
+}
+
+// fakeOverlayFileInfo is a minimal os.FileInfo for an overlay file
+// that does not exist on disk, used only so that ReadDir lists it.
+type fakeOverlayFileInfo string
+
+func (f fakeOverlayFileInfo) Name() string       { return string(f) }
+func (f fakeOverlayFileInfo) Size() int64        { return 0 }
+func (f fakeOverlayFileInfo) Mode() os.FileMode  { return 0644 }
+func (f fakeOverlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeOverlayFileInfo) IsDir() bool        { return false }
+func (f fakeOverlayFileInfo) Sys() interface{}   { return nil }
+
 // parsePackageFiles enumerates the files belonging to package path,
 // then loads, parses and returns them.
 //
 // 'which' is a list of flags indicating which files to include:
-//    'g': include non-test *.go source files (GoFiles)
-//    't': include in-package *_test.go source files (TestGoFiles)
-//    'x': include external *_test.go source files. (XTestGoFiles)
 //
-func parsePackageFiles(ctxt *build.Context, fset *token.FileSet, path string, which string) ([]*ast.File, error) {
-	// Set the "!cgo" go/build tag, preferring (dummy) Go to
-	// native C implementations of net.cgoLookupHost et al.
-	ctxt2 := *ctxt
-	ctxt2.CgoEnabled = false
+//	'g': include non-test *.go source files (GoFiles)
+//	't': include in-package *_test.go source files (TestGoFiles)
+//	'x': include external *_test.go source files. (XTestGoFiles)
+//
+// overlay, if non-nil, maps absolute file paths to replacement
+// source bytes; it is consulted both when ctxt2.Import enumerates
+// the package's files and when those files are subsequently parsed,
+// so that e.g. an unsaved editor buffer is seen consistently.
+//
+// cgoEnabled, if true, additionally runs the cgo tool over the
+// package's CgoFiles (if any) and includes the generated files, so
+// that packages that "import \"C\"" can be loaded like any other.
+// When false (the default), the "!cgo" build tag is set instead,
+// preferring (dummy) Go to native C implementations such as
+// net.cgoLookupHost.
+func parsePackageFiles(ctxt *build.Context, fset *token.FileSet, path string, which string, overlay map[string][]byte, cgoEnabled bool, limiter chan struct{}) ([]*ast.File, error) {
+	ctxt2 := *overlayContext(ctxt, overlay)
+	ctxt2.CgoEnabled = cgoEnabled
 
 	// Import(srcDir="") disables local imports, e.g. import "./foo".
 	bp, err := ctxt2.Import(path, "", 0)
@@ -55,13 +158,43 @@ func parsePackageFiles(ctxt *build.Context, fset *token.FileSet, path string, wh
 		}
 		filenames = append(filenames, s...)
 	}
-	return parseFiles(fset, bp.Dir, filenames...)
+
+	var generated []string
+	if cgoEnabled {
+		generated, err = cgoFiles(&ctxt2, bp)
+		if err != nil {
+			return nil, fmt.Errorf("cgo preprocessing failed for %q: %v", path, err)
+		}
+	}
+
+	files, err := parseFiles(fset, bp.Dir, filenames, overlay, limiter)
+	if err != nil {
+		return nil, err
+	}
+	if len(generated) > 0 {
+		genAST, err := parseFiles(fset, "", generated, nil, limiter)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, genAST...)
+	}
+	return files, nil
 }
 
 // parseFiles parses the Go source files files within directory dir
 // and returns their ASTs, or the first parse error if any.
 //
-func parseFiles(fset *token.FileSet, dir string, files ...string) ([]*ast.File, error) {
+// If a file's absolute path is a key in overlay, its replacement
+// bytes are parsed instead of the file's contents on disk.
+//
+// limiter, if non-nil, bounds the number of files parsed
+// concurrently across the whole load: each goroutine sends on
+// limiter before parsing and receives from it afterwards, so
+// callers share a single pool sized by Config.ParserConcurrency.
+// One goroutine is still started per file; only the number of
+// parser.ParseFile calls running at once is bounded. If limiter is
+// nil, parsing is unbounded, as before.
+func parseFiles(fset *token.FileSet, dir string, files []string, overlay map[string][]byte, limiter chan struct{}) ([]*ast.File, error) {
 	var wg sync.WaitGroup
 	n := len(files)
 	parsed := make([]*ast.File, n, n)
@@ -72,8 +205,20 @@ func parseFiles(fset *token.FileSet, dir string, files ...string) ([]*ast.File,
 		}
 		wg.Add(1)
 		go func(i int, file string) {
-			parsed[i], errors[i] = parser.ParseFile(fset, file, nil, 0)
-			wg.Done()
+			defer wg.Done()
+			if limiter != nil {
+				limiter <- struct{}{}
+				defer func() { <-limiter }()
+			}
+			var src interface{}
+			key := file
+			if abs, err := filepath.Abs(file); err == nil {
+				key = abs
+			}
+			if contents, ok := overlay[key]; ok {
+				src = contents
+			}
+			parsed[i], errors[i] = parser.ParseFile(fset, file, src, 0)
 		}(i, file)
 	}
 	wg.Wait()
@@ -132,4 +277,4 @@ func tokenFileContainsPos(f *token.File, pos token.Pos) bool {
 
 func filename(file *ast.File, fset *token.FileSet) string {
 	return fset.File(file.Pos()).Name()
-}
\ No newline at end of file
+}
@@ -0,0 +1,61 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"go/build"
+	"path/filepath"
+	"testing"
+)
+
+// TestOverlayContextNilHooks ensures that overlayContext's IsDir and
+// ReadDir hooks fall back to the OS when build.Default leaves its
+// hooks unset, rather than dereferencing a nil hook.
+func TestOverlayContextNilHooks(t *testing.T) {
+	overlay := map[string][]byte{
+		filepath.Join(build.Default.GOROOT, "src", "unrelated.go"): []byte("package unrelated\n"),
+	}
+	ctxt := overlayContext(&build.Default, overlay)
+
+	fmtDir := filepath.Join(build.Default.GOROOT, "src", "fmt")
+	if !ctxt.IsDir(fmtDir) {
+		t.Errorf("IsDir(%s) = false, want true", fmtDir)
+	}
+	if _, err := ctxt.ReadDir(fmtDir); err != nil {
+		t.Errorf("ReadDir(%s): %v", fmtDir, err)
+	}
+}
+
+// TestOverlayContextServesOverlaidFile checks that a file named by
+// the overlay is served from memory, and that ReadDir synthesizes
+// an entry for an overlaid file that doesn't yet exist on disk.
+func TestOverlayContextServesOverlaidFile(t *testing.T) {
+	dir := filepath.Join(build.Default.GOROOT, "src", "fmt")
+	overlaid := filepath.Join(dir, "zz_overlay_only.go")
+	overlay := map[string][]byte{
+		overlaid: []byte("package fmt\n"),
+	}
+	ctxt := overlayContext(&build.Default, overlay)
+
+	rc, err := ctxt.OpenFile(overlaid)
+	if err != nil {
+		t.Fatalf("OpenFile(%s): %v", overlaid, err)
+	}
+	rc.Close()
+
+	fis, err := ctxt.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir(%s): %v", dir, err)
+	}
+	var found bool
+	for _, fi := range fis {
+		if fi.Name() == filepath.Base(overlaid) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ReadDir(%s) did not include overlaid file %s", dir, filepath.Base(overlaid))
+	}
+}